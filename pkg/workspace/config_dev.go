@@ -0,0 +1,39 @@
+//go:build dev
+
+//
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+//
+// See LICENSE.txt for license information
+//
+
+package workspace
+
+import (
+	"path/filepath"
+)
+
+// getPathToConfigDir returns the directory holding the workspace's
+// configuration file. In dev builds, this is a dot-directory in the current
+// working directory, so iterating on a checkout never touches the user's
+// real configuration.
+func (w *Config) getPathToConfigDir() (string, error) {
+	if w.ConfDir == "" {
+		w.ConfDir = "."
+	}
+	return filepath.Join(w.ConfDir, "."+w.Name), nil
+}
+
+func (w *Config) getConfigFilePath() (string, error) {
+	configDir, err := w.getPathToConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, configFileName), nil
+}
+
+// registryRootDir returns the directory holding the shared registry file. In
+// dev builds, this is a dot-directory in the current working directory, so
+// iterating on a checkout never touches the user's real registry.
+func registryRootDir() (string, error) {
+	return "." + registryDirName, nil
+}
@@ -0,0 +1,17 @@
+//go:build dev
+
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package workspace
+
+import "path/filepath"
+
+// expectedConfigFilePath mirrors getPathToConfigDir/getConfigFilePath's dev
+// build layout: the configuration directory is a dot-prefixed directory
+// nested under confDir.
+func expectedConfigFilePath(confDir string, name string) string {
+	return filepath.Join(confDir, "."+name, configFileName)
+}
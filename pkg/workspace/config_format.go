@@ -0,0 +1,164 @@
+//
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+//
+// See LICENSE.txt for license information
+//
+
+package workspace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// currentConfigSchemaVersion is bumped every time configSchema gains or changes
+// a field in a way that requires a migration step
+const currentConfigSchemaVersion = 1
+
+type configFormat int
+
+const (
+	formatLegacyKV configFormat = iota
+	formatJSON
+	formatYAML
+)
+
+// configSchema is the on-disk representation of a Config. It is kept separate
+// from Config itself so the file format can evolve (new fields, migrations)
+// without changing the in-memory API.
+type configSchema struct {
+	SchemaVersion         int               `json:"schema_version" yaml:"schema_version"`
+	Basedir               string            `json:"basedir" yaml:"basedir"`
+	MpiDir                string            `json:"mpi_dir,omitempty" yaml:"mpi_dir,omitempty"`
+	MpirunArgs            string            `json:"mpirun_args,omitempty" yaml:"mpirun_args,omitempty"`
+	DirOverrides          map[string]string `json:"dir_overrides,omitempty" yaml:"dir_overrides,omitempty"`
+	EnvVars               map[string]string `json:"env_vars,omitempty" yaml:"env_vars,omitempty"`
+	ModuleHints           []string          `json:"module_hints,omitempty" yaml:"module_hints,omitempty"`
+	InstalledSoftware     []string          `json:"installed_software,omitempty" yaml:"installed_software,omitempty"`
+	InstalledSoftwareURLs map[string]string `json:"installed_software_urls,omitempty" yaml:"installed_software_urls,omitempty"`
+}
+
+// detectConfigFormat sniffs the content of a configuration file to figure out
+// whether it is the legacy key=value format or one of the structured formats.
+func detectConfigFormat(data []byte) configFormat {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return formatJSON
+	}
+
+	// The legacy format is made of "key=value" lines; the structured YAML
+	// format is made of "key: value" lines. That is enough to tell them apart.
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "=") && !strings.Contains(line, ":") {
+			return formatLegacyKV
+		}
+		break
+	}
+
+	return formatYAML
+}
+
+func unmarshalSchema(data []byte, format configFormat) (*configSchema, error) {
+	s := new(configSchema)
+
+	var err error
+	switch format {
+	case formatJSON:
+		err = json.Unmarshal(data, s)
+	case formatYAML:
+		err = yaml.Unmarshal(data, s)
+	default:
+		return nil, fmt.Errorf("unsupported configuration format")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse configuration file: %s", err)
+	}
+
+	return s, nil
+}
+
+// toSchema captures the subset of Config that is persisted to disk
+func (w *Config) toSchema() *configSchema {
+	return &configSchema{
+		SchemaVersion:         currentConfigSchemaVersion,
+		Basedir:               w.Basedir,
+		MpiDir:                w.MpiDir,
+		MpirunArgs:            w.MpirunArgs,
+		DirOverrides:          w.DirOverrides,
+		EnvVars:               w.EnvVars,
+		ModuleHints:           w.ModuleHints,
+		InstalledSoftware:     w.InstalledSoftware,
+		InstalledSoftwareURLs: w.InstalledSoftwareURLs,
+	}
+}
+
+func (w *Config) applySchema(s *configSchema) {
+	w.Basedir = s.Basedir
+	w.MpiDir = s.MpiDir
+	w.MpirunArgs = s.MpirunArgs
+	w.DirOverrides = s.DirOverrides
+	w.EnvVars = s.EnvVars
+	w.ModuleHints = s.ModuleHints
+	w.InstalledSoftwareURLs = s.InstalledSoftwareURLs
+	w.InstalledSoftware = s.InstalledSoftware
+}
+
+// migrateSchemaIfNeeded rewrites the configuration file when it was saved
+// with an older schema version. Each step below is expected to only ever
+// add/rename fields, never to remove information silently.
+func (w *Config) migrateSchemaIfNeeded(s *configSchema) error {
+	if s.SchemaVersion >= currentConfigSchemaVersion {
+		return nil
+	}
+
+	// No migration steps exist yet: currentConfigSchemaVersion is the first
+	// structured version. Future schema bumps add the necessary field
+	// translations here before falling through to the rewrite below.
+
+	return w.writeConfigFile()
+}
+
+// isYAMLConfigFile reports whether the configuration file should be
+// serialized as YAML instead of the JSON default, based on its extension.
+func (w *Config) isYAMLConfigFile() bool {
+	return strings.HasSuffix(w.ConfigFile, ".yaml") || strings.HasSuffix(w.ConfigFile, ".yml")
+}
+
+// writeConfigFile (re)serializes the workspace's configuration to disk using
+// the current schema, in JSON by default or YAML if the configuration file
+// has a .yaml/.yml extension.
+func (w *Config) writeConfigFile() error {
+	s := w.toSchema()
+
+	var data []byte
+	var err error
+	if w.isYAMLConfigFile() {
+		data, err = yaml.Marshal(s)
+	} else {
+		data, err = json.MarshalIndent(s, "", "\t")
+	}
+	if err != nil {
+		return fmt.Errorf("unable to serialize configuration: %s", err)
+	}
+
+	f, err := os.Create(w.ConfigFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	if err != nil {
+		return err
+	}
+	// close is deferred and we need to make sure the content is written to the file asap
+	return f.Sync()
+}
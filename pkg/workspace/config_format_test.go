@@ -0,0 +1,140 @@
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package workspace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectConfigFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want configFormat
+	}{
+		{"legacy kv", "dir=/home/user/workspace\n", formatLegacyKV},
+		{"legacy kv with comment", "# comment\ndir=/home/user/workspace\n", formatLegacyKV},
+		{"json", `{"schema_version": 1, "basedir": "/home/user/workspace"}`, formatJSON},
+		{"yaml", "schema_version: 1\nbasedir: /home/user/workspace\n", formatYAML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectConfigFormat([]byte(tt.data)); got != tt.want {
+				t.Fatalf("detectConfigFormat(%q) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCfgMigratesLegacyKV(t *testing.T) {
+	confDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unable to create test directory: %s", err)
+	}
+	defer os.RemoveAll(confDir)
+
+	configFile := filepath.Join(confDir, "workspace.conf")
+	if err := os.WriteFile(configFile, []byte("dir=/some/legacy/path\n"), 0644); err != nil {
+		t.Fatalf("unable to write %s: %s", configFile, err)
+	}
+
+	w := &Config{Name: "test_workspace", ConfigFile: configFile}
+	if err := w.ParseCfg(); err != nil {
+		t.Fatalf("ParseCfg failed: %s", err)
+	}
+	if w.Basedir != "/some/legacy/path" {
+		t.Fatalf("Basedir = %q after migrating a legacy config, want %q", w.Basedir, "/some/legacy/path")
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatalf("unable to read %s: %s", configFile, err)
+	}
+	if detectConfigFormat(data) != formatJSON {
+		t.Fatalf("legacy configuration file was not rewritten to JSON in place: %s", data)
+	}
+
+	// Loading the migrated file a second time must produce the same result.
+	w2 := &Config{Name: "test_workspace", ConfigFile: configFile}
+	if err := w2.ParseCfg(); err != nil {
+		t.Fatalf("ParseCfg failed on the migrated configuration file: %s", err)
+	}
+	if w2.Basedir != w.Basedir {
+		t.Fatalf("Basedir = %q after reloading the migrated file, want %q", w2.Basedir, w.Basedir)
+	}
+}
+
+func TestParseCfgYAMLRoundTrip(t *testing.T) {
+	confDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unable to create test directory: %s", err)
+	}
+	defer os.RemoveAll(confDir)
+
+	configFile := filepath.Join(confDir, "workspace.yaml")
+
+	w := &Config{
+		Name:       "test_workspace",
+		ConfigFile: configFile,
+		Basedir:    "/some/base/dir",
+		MpiDir:     "/opt/mpi",
+		MpirunArgs: "--bind-to core",
+		DirOverrides: map[string]string{
+			"build": "/scratch/build",
+		},
+		EnvVars: map[string]string{
+			"FOO": "bar",
+		},
+		ModuleHints:           []string{"gcc/11"},
+		InstalledSoftware:     []string{"ucx"},
+		InstalledSoftwareURLs: map[string]string{"ucx": "https://example.com/ucx.tar.gz"},
+	}
+	if err := w.writeConfigFile(); err != nil {
+		t.Fatalf("writeConfigFile failed: %s", err)
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatalf("unable to read %s: %s", configFile, err)
+	}
+	if detectConfigFormat(data) != formatYAML {
+		t.Fatalf("configuration file with a .yaml extension was not written as YAML: %s", data)
+	}
+
+	got := &Config{Name: "test_workspace", ConfigFile: configFile}
+	if err := got.ParseCfg(); err != nil {
+		t.Fatalf("ParseCfg failed: %s", err)
+	}
+
+	if got.Basedir != w.Basedir {
+		t.Fatalf("Basedir = %q, want %q", got.Basedir, w.Basedir)
+	}
+	if got.MpiDir != w.MpiDir {
+		t.Fatalf("MpiDir = %q, want %q", got.MpiDir, w.MpiDir)
+	}
+	if got.MpirunArgs != w.MpirunArgs {
+		t.Fatalf("MpirunArgs = %q, want %q", got.MpirunArgs, w.MpirunArgs)
+	}
+	if got.DirOverrides["build"] != w.DirOverrides["build"] {
+		t.Fatalf("DirOverrides[build] = %q, want %q", got.DirOverrides["build"], w.DirOverrides["build"])
+	}
+	if got.EnvVars["FOO"] != w.EnvVars["FOO"] {
+		t.Fatalf("EnvVars[FOO] = %q, want %q", got.EnvVars["FOO"], w.EnvVars["FOO"])
+	}
+	if len(got.ModuleHints) != 1 || got.ModuleHints[0] != "gcc/11" {
+		t.Fatalf("ModuleHints = %+v, want [gcc/11]", got.ModuleHints)
+	}
+	if len(got.InstalledSoftware) != 1 || got.InstalledSoftware[0] != "ucx" {
+		t.Fatalf("InstalledSoftware = %+v, want [ucx]", got.InstalledSoftware)
+	}
+	if got.InstalledSoftwareURLs["ucx"] != w.InstalledSoftwareURLs["ucx"] {
+		t.Fatalf("InstalledSoftwareURLs[ucx] = %q, want %q", got.InstalledSoftwareURLs["ucx"], w.InstalledSoftwareURLs["ucx"])
+	}
+}
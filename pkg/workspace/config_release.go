@@ -0,0 +1,50 @@
+//go:build !dev
+
+//
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+//
+// See LICENSE.txt for license information
+//
+
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// getPathToConfigDir returns the directory holding the workspace's
+// configuration file. In release builds, this is the OS-appropriate user
+// configuration directory (e.g. ~/.config on Linux, %AppData% on Windows),
+// namespaced by workspace name so several workspaces can coexist.
+func (w *Config) getPathToConfigDir() (string, error) {
+	if w.ConfDir == "" {
+		base, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to determine the user's configuration directory: %s", err)
+		}
+		w.ConfDir = filepath.Join(base, "go_workspace")
+	}
+	return filepath.Join(w.ConfDir, w.Name), nil
+}
+
+func (w *Config) getConfigFilePath() (string, error) {
+	configDir, err := w.getPathToConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, configFileName), nil
+}
+
+// registryRootDir returns the directory holding the shared registry file. In
+// release builds, this is the same OS-appropriate user configuration
+// directory used for workspace configuration files, unqualified by workspace
+// name since the registry is shared across all of them.
+func registryRootDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine the user's configuration directory: %s", err)
+	}
+	return filepath.Join(base, registryDirName), nil
+}
@@ -0,0 +1,244 @@
+//
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+//
+// See LICENSE.txt for license information
+//
+
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gvallee/go_util/pkg/util"
+)
+
+const installedManifestFileName = "installed.json"
+
+// InstalledSoftwareEntry is a single entry of the workspace's installed-software
+// manifest, recording everything needed to list, uninstall, or reinstall a
+// package without rebuilding it from scratch.
+type InstalledSoftwareEntry struct {
+	Name          string    `json:"name"`
+	URL           string    `json:"url"`
+	Version       string    `json:"version,omitempty"`
+	ConfigureArgs []string  `json:"configure_args,omitempty"`
+	InstallPrefix string    `json:"install_prefix"`
+	InstalledAt   time.Time `json:"installed_at"`
+	DependsOn     []string  `json:"depends_on,omitempty"`
+}
+
+// installedManifest is the on-disk format of Basedir/installed.json
+type installedManifest struct {
+	Software []InstalledSoftwareEntry `json:"software"`
+}
+
+func (w *Config) installedManifestPath() string {
+	return filepath.Join(w.Basedir, installedManifestFileName)
+}
+
+func (w *Config) loadInstalledManifest() (*installedManifest, error) {
+	path := w.installedManifestPath()
+
+	m := new(installedManifest)
+	if !util.FileExists(path) {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read installed-software manifest %s: %s", path, err)
+	}
+	if len(data) == 0 {
+		return m, nil
+	}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse installed-software manifest %s: %s", path, err)
+	}
+
+	return m, nil
+}
+
+func (w *Config) saveInstalledManifest(m *installedManifest) error {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to serialize installed-software manifest: %s", err)
+	}
+
+	err = os.WriteFile(w.installedManifestPath(), data, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write installed-software manifest %s: %s", w.installedManifestPath(), err)
+	}
+
+	return nil
+}
+
+// find returns the index of the first entry matching name, restricted to
+// version when version is not empty. It returns -1 when no entry matches.
+func (m *installedManifest) find(name string, version string) int {
+	for i, e := range m.Software {
+		if e.Name == name && (version == "" || e.Version == version) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ListInstalled returns every package recorded in the workspace's
+// installed-software manifest. It only takes a shared lock, so it can run
+// concurrently with other readers; it fails while another process holds the
+// exclusive lock (e.g. during a build).
+func (w *Config) ListInstalled() ([]InstalledSoftwareEntry, error) {
+	var software []InstalledSoftwareEntry
+	err := w.WithReadLock(func() error {
+		m, err := w.loadInstalledManifest()
+		if err != nil {
+			return err
+		}
+		software = m.Software
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return software, nil
+}
+
+// IsInstalled reports whether a package is recorded as installed. When
+// version is empty, any installed version of the package matches. It also
+// reports false when the lock cannot be taken or the manifest cannot be read.
+func (w *Config) IsInstalled(name string, version string) bool {
+	found := false
+	_ = w.WithReadLock(func() error {
+		m, err := w.loadInstalledManifest()
+		if err != nil {
+			return err
+		}
+		found = m.find(name, version) != -1
+		return nil
+	})
+	return found
+}
+
+// recordInstall adds or updates a manifest entry for a freshly installed
+// package.
+func (w *Config) recordInstall(entry InstalledSoftwareEntry) error {
+	m, err := w.loadInstalledManifest()
+	if err != nil {
+		return err
+	}
+
+	if idx := m.find(entry.Name, entry.Version); idx != -1 {
+		m.Software[idx] = entry
+	} else {
+		m.Software = append(m.Software, entry)
+	}
+
+	return w.saveInstalledManifest(m)
+}
+
+// UninstallSoftware removes a package's install prefix and drops it from the
+// installed-software manifest. When version is empty, every installed
+// version of the package is removed along with the package's top-level
+// install directory. UninstallSoftware refuses to remove a package that
+// another manifest entry still depends on.
+func (w *Config) UninstallSoftware(name string, version string) error {
+	return w.WithLock(func() error {
+		m, err := w.loadInstalledManifest()
+		if err != nil {
+			return err
+		}
+
+		if m.find(name, version) == -1 {
+			return fmt.Errorf("package %s is not installed", describeSoftware(name, version))
+		}
+
+		for _, e := range m.Software {
+			if e.Name == name && (version == "" || e.Version == version) {
+				continue
+			}
+			for _, dep := range e.DependsOn {
+				if dep == name {
+					return fmt.Errorf("cannot uninstall %s: %s depends on it", name, e.Name)
+				}
+			}
+		}
+
+		prefix := filepath.Join(w.InstallDir, name)
+		if !util.IsDir(prefix) {
+			return fmt.Errorf("install prefix %s does not exist", prefix)
+		}
+
+		if version == "" {
+			err = os.RemoveAll(prefix)
+			if err != nil {
+				return fmt.Errorf("unable to remove %s: %s", prefix, err)
+			}
+		} else {
+			versionDir := filepath.Join(prefix, version)
+			if !util.IsDir(versionDir) {
+				return fmt.Errorf("version %s of %s is not installed under %s", version, name, prefix)
+			}
+			err = os.RemoveAll(versionDir)
+			if err != nil {
+				return fmt.Errorf("unable to remove %s: %s", versionDir, err)
+			}
+
+			remainingVersions, err := os.ReadDir(prefix)
+			if err == nil && len(remainingVersions) == 0 {
+				err = os.RemoveAll(prefix)
+				if err != nil {
+					return fmt.Errorf("unable to remove %s: %s", prefix, err)
+				}
+			}
+		}
+
+		newSoftware := make([]InstalledSoftwareEntry, 0, len(m.Software))
+		for _, e := range m.Software {
+			if e.Name == name && (version == "" || e.Version == version) {
+				continue
+			}
+			newSoftware = append(newSoftware, e)
+		}
+		m.Software = newSoftware
+
+		return w.saveInstalledManifest(m)
+	})
+}
+
+// Reinstall uninstalls and reinstalls a package using the configure
+// arguments, URL, and version of the first manifest entry recorded for name.
+// When several versions are installed, only that entry's version is
+// reinstalled.
+func (w *Config) Reinstall(name string) error {
+	return w.WithLock(func() error {
+		m, err := w.loadInstalledManifest()
+		if err != nil {
+			return err
+		}
+
+		idx := m.find(name, "")
+		if idx == -1 {
+			return fmt.Errorf("package %s is not installed", name)
+		}
+		entry := m.Software[idx]
+
+		err = w.UninstallSoftware(entry.Name, entry.Version)
+		if err != nil {
+			return err
+		}
+
+		return w.InstallSoftwareWithDeps(entry.Name, entry.URL, entry.Version, entry.ConfigureArgs, entry.DependsOn)
+	})
+}
+
+func describeSoftware(name string, version string) string {
+	if version == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (version %s)", name, version)
+}
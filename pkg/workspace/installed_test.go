@@ -0,0 +1,154 @@
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListInstalledAndIsInstalled(t *testing.T) {
+	w := newTestWorkspace(t, "test_workspace")
+
+	entry := InstalledSoftwareEntry{
+		Name:        "foo",
+		URL:         "https://example.com/foo.tar.gz",
+		Version:     "1.0",
+		InstalledAt: time.Now().UTC(),
+	}
+	if err := w.recordInstall(entry); err != nil {
+		t.Fatalf("recordInstall failed: %s", err)
+	}
+
+	software, err := w.ListInstalled()
+	if err != nil {
+		t.Fatalf("ListInstalled failed: %s", err)
+	}
+	if len(software) != 1 || software[0].Name != "foo" {
+		t.Fatalf("ListInstalled returned %+v, want a single foo entry", software)
+	}
+
+	if !w.IsInstalled("foo", "") {
+		t.Fatalf("IsInstalled(foo, \"\") = false, want true")
+	}
+	if !w.IsInstalled("foo", "1.0") {
+		t.Fatalf("IsInstalled(foo, 1.0) = false, want true")
+	}
+	if w.IsInstalled("foo", "2.0") {
+		t.Fatalf("IsInstalled(foo, 2.0) = true, want false")
+	}
+	if w.IsInstalled("bar", "") {
+		t.Fatalf("IsInstalled(bar, \"\") = true, want false")
+	}
+}
+
+func TestUninstallSoftwareWholePrefix(t *testing.T) {
+	w := newTestWorkspace(t, "test_workspace")
+
+	prefix := filepath.Join(w.InstallDir, "foo")
+	if err := os.MkdirAll(prefix, defaultWPMode); err != nil {
+		t.Fatalf("unable to create %s: %s", prefix, err)
+	}
+	if err := w.recordInstall(InstalledSoftwareEntry{Name: "foo", InstalledAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("recordInstall failed: %s", err)
+	}
+
+	if err := w.UninstallSoftware("foo", ""); err != nil {
+		t.Fatalf("UninstallSoftware failed: %s", err)
+	}
+
+	if _, err := os.Stat(prefix); !os.IsNotExist(err) {
+		t.Fatalf("install prefix %s still exists after uninstall", prefix)
+	}
+	if w.IsInstalled("foo", "") {
+		t.Fatalf("foo is still recorded as installed after uninstall")
+	}
+}
+
+func TestUninstallSoftwareVersioned(t *testing.T) {
+	w := newTestWorkspace(t, "test_workspace")
+
+	prefix := filepath.Join(w.InstallDir, "foo")
+	v1 := filepath.Join(prefix, "1.0")
+	v2 := filepath.Join(prefix, "2.0")
+	if err := os.MkdirAll(v1, defaultWPMode); err != nil {
+		t.Fatalf("unable to create %s: %s", v1, err)
+	}
+	if err := os.MkdirAll(v2, defaultWPMode); err != nil {
+		t.Fatalf("unable to create %s: %s", v2, err)
+	}
+	if err := w.recordInstall(InstalledSoftwareEntry{Name: "foo", Version: "1.0", InstalledAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("recordInstall failed: %s", err)
+	}
+	if err := w.recordInstall(InstalledSoftwareEntry{Name: "foo", Version: "2.0", InstalledAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("recordInstall failed: %s", err)
+	}
+
+	if err := w.UninstallSoftware("foo", "1.0"); err != nil {
+		t.Fatalf("UninstallSoftware failed: %s", err)
+	}
+
+	if _, err := os.Stat(v1); !os.IsNotExist(err) {
+		t.Fatalf("version directory %s still exists after uninstall", v1)
+	}
+	if _, err := os.Stat(v2); err != nil {
+		t.Fatalf("version directory %s was unexpectedly removed: %s", v2, err)
+	}
+	if _, err := os.Stat(prefix); err != nil {
+		t.Fatalf("install prefix %s was unexpectedly removed while a version remains: %s", prefix, err)
+	}
+	if w.IsInstalled("foo", "1.0") {
+		t.Fatalf("foo 1.0 is still recorded as installed after uninstall")
+	}
+	if !w.IsInstalled("foo", "2.0") {
+		t.Fatalf("foo 2.0 is no longer recorded as installed")
+	}
+}
+
+func TestUninstallSoftwareRefusesWhenDependedOn(t *testing.T) {
+	w := newTestWorkspace(t, "test_workspace")
+
+	prefix := filepath.Join(w.InstallDir, "foo")
+	if err := os.MkdirAll(prefix, defaultWPMode); err != nil {
+		t.Fatalf("unable to create %s: %s", prefix, err)
+	}
+	if err := w.recordInstall(InstalledSoftwareEntry{Name: "foo", InstalledAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("recordInstall failed: %s", err)
+	}
+	if err := w.recordInstall(InstalledSoftwareEntry{Name: "bar", InstalledAt: time.Now().UTC(), DependsOn: []string{"foo"}}); err != nil {
+		t.Fatalf("recordInstall failed: %s", err)
+	}
+
+	err := w.UninstallSoftware("foo", "")
+	if err == nil {
+		t.Fatalf("UninstallSoftware did not refuse to remove a package another one depends on")
+	}
+
+	if _, err := os.Stat(prefix); err != nil {
+		t.Fatalf("install prefix %s was removed despite the refusal: %s", prefix, err)
+	}
+	if !w.IsInstalled("foo", "") {
+		t.Fatalf("foo is no longer recorded as installed despite the refusal")
+	}
+}
+
+func TestUninstallSoftwareNotInstalled(t *testing.T) {
+	w := newTestWorkspace(t, "test_workspace")
+
+	if err := w.UninstallSoftware("does_not_exist", ""); err == nil {
+		t.Fatalf("UninstallSoftware succeeded for a package that was never installed")
+	}
+}
+
+func TestReinstallUnknownPackage(t *testing.T) {
+	w := newTestWorkspace(t, "test_workspace")
+
+	if err := w.Reinstall("does_not_exist"); err == nil {
+		t.Fatalf("Reinstall succeeded for a package that was never installed")
+	}
+}
@@ -0,0 +1,191 @@
+//
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+//
+// See LICENSE.txt for license information
+//
+
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gvallee/go_util/pkg/util"
+	"golang.org/x/sys/unix"
+)
+
+const lockFileName = ".workspace.lock"
+
+type lockMode int
+
+const (
+	lockModeShared lockMode = iota
+	lockModeExclusive
+)
+
+// workspaceLock represents an on-disk lock held by this process on behalf of
+// a Config
+type workspaceLock struct {
+	file *os.File
+	mode lockMode
+}
+
+func (w *Config) lockFilePath() string {
+	return filepath.Join(w.Basedir, lockFileName)
+}
+
+// acquireLock takes the workspace's on-disk lock in the requested mode.
+func (w *Config) acquireLock(mode lockMode) (*workspaceLock, error) {
+	if !util.PathExists(w.Basedir) {
+		err := os.MkdirAll(w.Basedir, defaultWPMode)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create workspace directory %s: %s", w.Basedir, err)
+		}
+	}
+
+	lk, err := acquireFileLock(w.lockFilePath(), mode)
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s is locked by another process: %s", w.Name, err)
+	}
+	return lk, nil
+}
+
+// acquireFileLock takes an exclusive or shared flock() on path, creating the
+// directory and file as needed. It recovers from a lock file left behind by
+// a process that has since died: flock() locks are released by the kernel
+// when their owner exits, so a second, non-blocking attempt is expected to
+// succeed once we have confirmed the recorded owner PID is gone.
+func acquireFileLock(path string, mode lockMode) (*workspaceLock, error) {
+	dir := filepath.Dir(path)
+	if !util.PathExists(dir) {
+		err := os.MkdirAll(dir, defaultWPMode)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create directory %s: %s", dir, err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file %s: %s", path, err)
+	}
+
+	op := unix.LOCK_SH
+	if mode == lockModeExclusive {
+		op = unix.LOCK_EX
+	}
+
+	err = unix.Flock(int(f.Fd()), op|unix.LOCK_NB)
+	if err != nil && isStaleLock(f) {
+		// The recorded owner is gone; the kernel already released its flock(),
+		// so a retry is expected to succeed.
+		err = unix.Flock(int(f.Fd()), op|unix.LOCK_NB)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if mode == lockModeExclusive {
+		err = recordLockOwner(f)
+		if err != nil {
+			unix.Flock(int(f.Fd()), unix.LOCK_UN)
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return &workspaceLock{file: f, mode: mode}, nil
+}
+
+// recordLockOwner stamps the lock file with our PID so a later process can
+// tell whether we are still alive
+func recordLockOwner(f *os.File) error {
+	err := f.Truncate(0)
+	if err != nil {
+		return fmt.Errorf("unable to record lock owner: %s", err)
+	}
+	_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	if err != nil {
+		return fmt.Errorf("unable to record lock owner: %s", err)
+	}
+	return f.Sync()
+}
+
+// isStaleLock reports whether the PID recorded in the lock file belongs to a
+// process that is no longer alive
+func isStaleLock(f *os.File) bool {
+	data := make([]byte, 32)
+	n, err := f.ReadAt(data, 0)
+	if err != nil && n == 0 {
+		return false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data[:n])))
+	if err != nil || pid <= 0 {
+		return false
+	}
+
+	// Sending signal 0 only checks whether the process exists; ESRCH means it
+	// does not.
+	return unix.Kill(pid, 0) == unix.ESRCH
+}
+
+func (lk *workspaceLock) release() error {
+	defer lk.file.Close()
+	return unix.Flock(int(lk.file.Fd()), unix.LOCK_UN)
+}
+
+// WithLock runs fn while holding an exclusive lock on the workspace, so that
+// concurrent processes calling Init, Load, or InstallSoftware never race on
+// the workspace's directories. WithLock is reentrant: if this Config already
+// holds the workspace's lock in exclusive mode, fn runs directly. A
+// nested WithLock call made while only a shared (read) lock is held would not
+// actually be exclusive, so it panics instead of silently under-protecting
+// its caller.
+func (w *Config) WithLock(fn func() error) error {
+	if w.lock != nil {
+		if w.lock.mode != lockModeExclusive {
+			panic(fmt.Sprintf("workspace %s: WithLock called while only a shared lock is held", w.Name))
+		}
+		return fn()
+	}
+
+	lk, err := w.acquireLock(lockModeExclusive)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		w.lock = nil
+		lk.release()
+	}()
+	w.lock = lk
+
+	return fn()
+}
+
+// WithReadLock runs fn while holding a shared lock on the workspace, allowing
+// multiple readers (e.g. ListInstalled) to proceed concurrently as long as no
+// writer holds the exclusive lock. WithReadLock is reentrant: if this Config
+// already holds the workspace's lock, in either mode, fn runs
+// directly, since an exclusive lock already provides everything a shared lock
+// would.
+func (w *Config) WithReadLock(fn func() error) error {
+	if w.lock != nil {
+		return fn()
+	}
+
+	lk, err := w.acquireLock(lockModeShared)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		w.lock = nil
+		lk.release()
+	}()
+	w.lock = lk
+
+	return fn()
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package workspace
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWithLockReentrant(t *testing.T) {
+	basedir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unable to create test directory: %s", err)
+	}
+	defer os.RemoveAll(basedir)
+
+	w := &Config{Name: "test_workspace", Basedir: basedir}
+
+	nestedRan := false
+	err = w.WithLock(func() error {
+		// A nested call from code that already holds the lock must not deadlock
+		return w.WithLock(func() error {
+			nestedRan = true
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %s", err)
+	}
+	if !nestedRan {
+		t.Fatalf("nested WithLock call never ran")
+	}
+	if w.lock != nil {
+		t.Fatalf("lock was not released after WithLock returned")
+	}
+}
+
+func TestWithReadLockReentrant(t *testing.T) {
+	basedir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unable to create test directory: %s", err)
+	}
+	defer os.RemoveAll(basedir)
+
+	w := &Config{Name: "test_workspace", Basedir: basedir}
+
+	nestedRan := false
+	err = w.WithReadLock(func() error {
+		// A nested read lock from code that already holds a shared lock must
+		// not deadlock.
+		return w.WithReadLock(func() error {
+			nestedRan = true
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithReadLock failed: %s", err)
+	}
+	if !nestedRan {
+		t.Fatalf("nested WithReadLock call never ran")
+	}
+	if w.lock != nil {
+		t.Fatalf("lock was not released after WithReadLock returned")
+	}
+}
+
+// TestWithLockPanicsUnderSharedLock verifies that a nested WithLock call made
+// while only a shared lock is held panics instead of silently running
+// without real exclusive protection.
+func TestWithLockPanicsUnderSharedLock(t *testing.T) {
+	basedir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unable to create test directory: %s", err)
+	}
+	defer os.RemoveAll(basedir)
+
+	w := &Config{Name: "test_workspace", Basedir: basedir}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("WithLock nested under WithReadLock did not panic")
+		}
+	}()
+
+	_ = w.WithReadLock(func() error {
+		return w.WithLock(func() error {
+			t.Fatalf("WithLock ran without acquiring real exclusive protection")
+			return nil
+		})
+	})
+}
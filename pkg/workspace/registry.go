@@ -0,0 +1,280 @@
+//
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+//
+// See LICENSE.txt for license information
+//
+
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gvallee/go_util/pkg/util"
+)
+
+const (
+	registryDirName      = "go_workspace"
+	registryFileName     = "registry.json"
+	registryLockFileName = "registry.lock"
+)
+
+// registryEntry is what we persist to disk for each workspace known to the registry.
+// It intentionally only stores enough to locate and reload the workspace's own
+// configuration; everything else is derived by Load()/ParseCfg().
+type registryEntry struct {
+	Name    string `json:"name"`
+	ConfDir string `json:"confdir"`
+	Basedir string `json:"basedir"`
+}
+
+// registryData is the on-disk format of the registry file
+type registryData struct {
+	Active  string          `json:"active"`
+	Entries []registryEntry `json:"entries"`
+}
+
+func getRegistryFilePath() (string, error) {
+	dir, err := registryRootDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, registryFileName), nil
+}
+
+func getRegistryLockFilePath() (string, error) {
+	dir, err := registryRootDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, registryLockFileName), nil
+}
+
+// withRegistryLock runs fn while holding the registry's on-disk lock in the
+// requested mode, so that concurrent processes registering, removing, or
+// activating workspaces never race on the shared registry file the way
+// WithLock/WithReadLock already protect a single workspace's own directories.
+func withRegistryLock(mode lockMode, fn func() error) error {
+	path, err := getRegistryLockFilePath()
+	if err != nil {
+		return err
+	}
+
+	lk, err := acquireFileLock(path, mode)
+	if err != nil {
+		return fmt.Errorf("registry is locked by another process: %s", err)
+	}
+	defer lk.release()
+
+	return fn()
+}
+
+func loadRegistry() (*registryData, error) {
+	path, err := getRegistryFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	reg := new(registryData)
+	if !util.FileExists(path) {
+		return reg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read registry file %s: %s", path, err)
+	}
+	if len(data) == 0 {
+		return reg, nil
+	}
+	err = json.Unmarshal(data, reg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse registry file %s: %s", path, err)
+	}
+
+	return reg, nil
+}
+
+func saveRegistry(reg *registryData) error {
+	path, err := getRegistryFilePath()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if !util.PathExists(dir) {
+		err := os.MkdirAll(dir, defaultWPMode)
+		if err != nil {
+			return fmt.Errorf("unable to create registry directory %s: %s", dir, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(reg, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to serialize registry: %s", err)
+	}
+
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write registry file %s: %s", path, err)
+	}
+
+	return nil
+}
+
+func (reg *registryData) find(name string) int {
+	for i, e := range reg.Entries {
+		if e.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// List returns all the workspaces currently tracked in the registry
+func List() ([]*Config, error) {
+	var configs []*Config
+	err := withRegistryLock(lockModeShared, func() error {
+		reg, err := loadRegistry()
+		if err != nil {
+			return err
+		}
+
+		configs = make([]*Config, 0, len(reg.Entries))
+		for _, e := range reg.Entries {
+			configs = append(configs, &Config{
+				Name:    e.Name,
+				ConfDir: e.ConfDir,
+				Basedir: e.Basedir,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// Get looks up a registered workspace by name. The returned Config still needs
+// to be passed to Load() to be fully populated/usable.
+func Get(name string) (*Config, error) {
+	var c *Config
+	err := withRegistryLock(lockModeShared, func() error {
+		reg, err := loadRegistry()
+		if err != nil {
+			return err
+		}
+
+		idx := reg.find(name)
+		if idx == -1 {
+			return fmt.Errorf("workspace %q is not registered", name)
+		}
+
+		e := reg.Entries[idx]
+		c = &Config{
+			Name:    e.Name,
+			ConfDir: e.ConfDir,
+			Basedir: e.Basedir,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Register adds a workspace to the registry, or updates its entry if it is
+// already registered. When no workspace is active (e.g. the first one ever
+// registered, or after the active one was removed), w becomes the active one.
+func Register(w *Config) error {
+	if w.Name == "" {
+		return fmt.Errorf("workspace name is undefined")
+	}
+
+	return withRegistryLock(lockModeExclusive, func() error {
+		reg, err := loadRegistry()
+		if err != nil {
+			return err
+		}
+
+		entry := registryEntry{
+			Name:    w.Name,
+			ConfDir: w.ConfDir,
+			Basedir: w.Basedir,
+		}
+		if idx := reg.find(w.Name); idx != -1 {
+			reg.Entries[idx] = entry
+		} else {
+			reg.Entries = append(reg.Entries, entry)
+		}
+		if reg.Active == "" {
+			reg.Active = w.Name
+		}
+
+		return saveRegistry(reg)
+	})
+}
+
+// Remove drops a workspace from the registry. It does not touch the
+// workspace's data or configuration file on disk.
+func Remove(name string) error {
+	return withRegistryLock(lockModeExclusive, func() error {
+		reg, err := loadRegistry()
+		if err != nil {
+			return err
+		}
+
+		idx := reg.find(name)
+		if idx == -1 {
+			return fmt.Errorf("workspace %q is not registered", name)
+		}
+		reg.Entries = append(reg.Entries[:idx], reg.Entries[idx+1:]...)
+		if reg.Active == name {
+			reg.Active = ""
+		}
+
+		return saveRegistry(reg)
+	})
+}
+
+// SetActive marks name as the active workspace. It must already be registered.
+func SetActive(name string) error {
+	return withRegistryLock(lockModeExclusive, func() error {
+		reg, err := loadRegistry()
+		if err != nil {
+			return err
+		}
+
+		if reg.find(name) == -1 {
+			return fmt.Errorf("workspace %q is not registered", name)
+		}
+		reg.Active = name
+
+		return saveRegistry(reg)
+	})
+}
+
+// GetActive returns the currently active workspace, if any is set.
+func GetActive() (*Config, error) {
+	var active string
+	err := withRegistryLock(lockModeShared, func() error {
+		reg, err := loadRegistry()
+		if err != nil {
+			return err
+		}
+		if reg.Active == "" {
+			return fmt.Errorf("no active workspace")
+		}
+		active = reg.Active
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return Get(active)
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package workspace
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// sandboxRegistry points registryRootDir() at a fresh temporary directory for
+// the duration of the test, in both release builds (which derive it from
+// os.UserConfigDir(), itself driven by $XDG_CONFIG_HOME/$HOME) and dev builds
+// (which resolve it relative to the current directory), so registry tests never touch a
+// real user's configuration.
+func sandboxRegistry(t *testing.T) {
+	t.Helper()
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unable to create test directory: %s", err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("HOME", tmp)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unable to determine the current directory: %s", err)
+	}
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatalf("unable to change to test directory: %s", err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+}
+
+func TestRegistryRoundTrip(t *testing.T) {
+	sandboxRegistry(t)
+
+	w := &Config{Name: "test_workspace", ConfDir: "conf", Basedir: "base"}
+	if err := Register(w); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+
+	got, err := Get(w.Name)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if got.ConfDir != w.ConfDir || got.Basedir != w.Basedir {
+		t.Fatalf("Get returned %+v, want ConfDir=%q Basedir=%q", got, w.ConfDir, w.Basedir)
+	}
+
+	all, err := List()
+	if err != nil {
+		t.Fatalf("List failed: %s", err)
+	}
+	if len(all) != 1 || all[0].Name != w.Name {
+		t.Fatalf("List returned %+v, want a single %q entry", all, w.Name)
+	}
+
+	if err := Remove(w.Name); err != nil {
+		t.Fatalf("Remove failed: %s", err)
+	}
+	if _, err := Get(w.Name); err == nil {
+		t.Fatalf("Get succeeded for a workspace that was just removed")
+	}
+	all, err = List()
+	if err != nil {
+		t.Fatalf("List failed: %s", err)
+	}
+	if len(all) != 0 {
+		t.Fatalf("List returned %+v after Remove, want no entries", all)
+	}
+}
+
+func TestRegistryFirstRegisteredBecomesActive(t *testing.T) {
+	sandboxRegistry(t)
+
+	first := &Config{Name: "first_workspace", Basedir: "base1"}
+	second := &Config{Name: "second_workspace", Basedir: "base2"}
+	if err := Register(first); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+	if err := Register(second); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+
+	active, err := GetActive()
+	if err != nil {
+		t.Fatalf("GetActive failed: %s", err)
+	}
+	if active.Name != first.Name {
+		t.Fatalf("GetActive returned %q, want %q (the first workspace registered)", active.Name, first.Name)
+	}
+
+	if err := SetActive(second.Name); err != nil {
+		t.Fatalf("SetActive failed: %s", err)
+	}
+	active, err = GetActive()
+	if err != nil {
+		t.Fatalf("GetActive failed: %s", err)
+	}
+	if active.Name != second.Name {
+		t.Fatalf("GetActive returned %q after SetActive, want %q", active.Name, second.Name)
+	}
+}
+
+func TestRegistrySetActiveUnknownWorkspace(t *testing.T) {
+	sandboxRegistry(t)
+
+	if err := SetActive("does_not_exist"); err == nil {
+		t.Fatalf("SetActive succeeded for a workspace that was never registered")
+	}
+}
+
+func TestRegistryGetActiveWithNoneSet(t *testing.T) {
+	sandboxRegistry(t)
+
+	if _, err := GetActive(); err == nil {
+		t.Fatalf("GetActive succeeded with no workspace ever registered")
+	}
+}
+
+// TestLoadImplicitlyRegisters exercises the implicit-registration branch in
+// Load(): a named workspace that is not yet known to the registry is
+// registered automatically the first time it is loaded.
+func TestLoadImplicitlyRegisters(t *testing.T) {
+	sandboxRegistry(t)
+
+	confDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unable to create test directory: %s", err)
+	}
+
+	w := &Config{Name: "implicit_workspace", ConfDir: confDir, Basedir: confDir}
+	// First call creates the configuration file and returns an error asking
+	// for review, exactly like TestCreate.
+	if err := w.Load(); err == nil {
+		t.Fatalf("workspace creation without a pre-existing configuration file succeeded")
+	}
+	// Second call parses the freshly created configuration file and should
+	// register the workspace.
+	if err := w.Load(); err != nil {
+		t.Fatalf("loading the workspace failed: %s", err)
+	}
+
+	if _, err := Get(w.Name); err != nil {
+		t.Fatalf("Load() did not implicitly register the workspace: %s", err)
+	}
+}
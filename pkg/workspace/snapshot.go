@@ -0,0 +1,336 @@
+//
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+//
+// See LICENSE.txt for license information
+//
+
+package workspace
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gvallee/go_util/pkg/util"
+)
+
+// snapshotSoftwareEntry is a single entry of a snapshot's manifest, recording
+// enough information to know what was installed at snapshot time
+type snapshotSoftwareEntry struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// snapshotManifest describes the content of a snapshot archive
+type snapshotManifest struct {
+	Name              string                  `json:"name"`
+	CreatedAt         time.Time               `json:"created_at"`
+	InstalledSoftware []snapshotSoftwareEntry `json:"installed_software"`
+}
+
+// Snapshot archives the workspace's install directory, source directory, and
+// configuration file into a single tar.gz under Basedir/snapshots, alongside
+// a manifest of the software known to be installed. It returns the path to
+// the resulting archive.
+func (w *Config) Snapshot(name string) (string, error) {
+	err := w.checkWorkspaceStructure()
+	if err != nil {
+		return "", err
+	}
+
+	var archivePath string
+	err = w.WithReadLock(func() error {
+		snapshotsDir := filepath.Join(w.Basedir, "snapshots")
+		if !util.PathExists(snapshotsDir) {
+			err := os.MkdirAll(snapshotsDir, defaultWPMode)
+			if err != nil {
+				return fmt.Errorf("unable to create snapshots directory %s: %s", snapshotsDir, err)
+			}
+		}
+
+		path := filepath.Join(snapshotsDir, fmt.Sprintf("%s-%s.tar.gz", name, time.Now().UTC().Format("20060102-150405")))
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("unable to create snapshot archive %s: %s", path, err)
+		}
+		defer f.Close()
+
+		gw := gzip.NewWriter(f)
+		defer gw.Close()
+		tw := tar.NewWriter(gw)
+		defer tw.Close()
+
+		manifest := snapshotManifest{
+			Name:      name,
+			CreatedAt: time.Now().UTC(),
+		}
+		for _, softwareName := range w.InstalledSoftware {
+			manifest.InstalledSoftware = append(manifest.InstalledSoftware, snapshotSoftwareEntry{
+				Name: softwareName,
+				URL:  w.InstalledSoftwareURLs[softwareName],
+			})
+		}
+		manifestData, err := json.MarshalIndent(manifest, "", "\t")
+		if err != nil {
+			return fmt.Errorf("unable to serialize snapshot manifest: %s", err)
+		}
+		err = addBytesToTar(tw, "manifest.json", manifestData)
+		if err != nil {
+			return err
+		}
+
+		err = addTreeToTar(tw, w.InstallDir, "install")
+		if err != nil {
+			return err
+		}
+
+		err = addTreeToTar(tw, w.SrcDir, "src")
+		if err != nil {
+			return err
+		}
+
+		if util.FileExists(w.ConfigFile) {
+			err = addFileToTar(tw, w.ConfigFile, filepath.Base(w.ConfigFile))
+			if err != nil {
+				return err
+			}
+		}
+
+		archivePath = path
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return archivePath, nil
+}
+
+func addBytesToTar(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(data)),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write tar header for %s: %s", name, err)
+	}
+	_, err = tw.Write(data)
+	if err != nil {
+		return fmt.Errorf("unable to write %s to archive: %s", name, err)
+	}
+	return nil
+}
+
+func addFileToTar(tw *tar.Writer, path string, archiveName string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unable to stat %s: %s", path, err)
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name: archiveName,
+		Mode: int64(info.Mode().Perm()),
+		Size: info.Size(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write tar header for %s: %s", path, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %s", path, err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	if err != nil {
+		return fmt.Errorf("unable to add %s to archive: %s", path, err)
+	}
+
+	return nil
+}
+
+// addTreeToTar walks dir and adds its content to tw, rooted at archivePrefix
+func addTreeToTar(tw *tar.Writer, dir string, archivePrefix string) error {
+	if !util.PathExists(dir) {
+		return nil
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("unable to compute relative path for %s: %s", path, err)
+		}
+
+		return addFileToTar(tw, path, filepath.Join(archivePrefix, rel))
+	})
+}
+
+// Clone reproduces the workspace's directory layout at dst's Basedir. dst's
+// Basedir must already be set; an empty Name defaults to the source
+// workspace's name. It does not install any software nor
+// copy any data; call RestoreSnapshot afterward to rehydrate from a snapshot.
+func (w *Config) Clone(dst *Config) error {
+	if dst.Basedir == "" {
+		return fmt.Errorf("destination workspace's base directory is undefined")
+	}
+	if dst.Name == "" {
+		dst.Name = w.Name
+	}
+
+	return w.WithReadLock(func() error {
+		return dst.Init()
+	})
+}
+
+// RestoreSnapshot extracts a snapshot archive created by Snapshot into the
+// workspace's install and source directories, overwriting their current
+// content.
+func (w *Config) RestoreSnapshot(archivePath string) error {
+	err := w.checkWorkspaceStructure()
+	if err != nil {
+		return err
+	}
+
+	return w.WithLock(func() error {
+		f, err := os.Open(archivePath)
+		if err != nil {
+			return fmt.Errorf("unable to open snapshot archive %s: %s", archivePath, err)
+		}
+		defer f.Close()
+
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("unable to read snapshot archive %s: %s", archivePath, err)
+		}
+		defer gr.Close()
+
+		tr := tar.NewReader(gr)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("unable to read snapshot archive %s: %s", archivePath, err)
+			}
+
+			var dst string
+			switch {
+			case header.Name == "manifest.json":
+				continue
+			case header.Name == filepath.Base(w.ConfigFile):
+				dst = w.ConfigFile
+			case len(header.Name) > len("install/") && header.Name[:len("install/")] == "install/":
+				dst, err = safeJoin(w.InstallDir, header.Name[len("install/"):])
+			case len(header.Name) > len("src/") && header.Name[:len("src/")] == "src/":
+				dst, err = safeJoin(w.SrcDir, header.Name[len("src/"):])
+			default:
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to restore snapshot archive %s: %s", archivePath, err)
+			}
+
+			err = os.MkdirAll(filepath.Dir(dst), defaultWPMode)
+			if err != nil {
+				return fmt.Errorf("unable to create directory for %s: %s", dst, err)
+			}
+			out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+			if err != nil {
+				return fmt.Errorf("unable to create %s: %s", dst, err)
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return fmt.Errorf("unable to restore %s: %s", dst, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// safeJoin joins rel onto root and rejects the result if it escapes root,
+// guarding RestoreSnapshot against a tar entry (e.g. "../../etc/passwd")
+// trying to write outside the workspace's directories.
+func safeJoin(root string, rel string) (string, error) {
+	dst := filepath.Join(root, rel)
+	if dst != root && !strings.HasPrefix(dst, root+string(os.PathSeparator)) {
+		return "", fmt.Errorf("entry %q escapes %s", rel, root)
+	}
+	return dst, nil
+}
+
+// CacheScope identifies which of a workspace's cache directories an
+// operation such as ClearCache should apply to
+type CacheScope int
+
+const (
+	CacheScopeDownload CacheScope = 1 << iota
+	CacheScopeBuild
+	CacheScopeScratch
+	CacheScopeAll = CacheScopeDownload | CacheScopeBuild | CacheScopeScratch
+)
+
+// ClearCache wipes the selected cache directories (download, build, and/or
+// scratch) without touching installed binaries.
+func (w *Config) ClearCache(scope CacheScope) error {
+	return w.WithLock(func() error {
+		if scope&CacheScopeDownload != 0 {
+			err := clearDir(w.DownloadDir)
+			if err != nil {
+				return err
+			}
+		}
+		if scope&CacheScopeBuild != 0 {
+			err := clearDir(w.BuildDir)
+			if err != nil {
+				return err
+			}
+		}
+		if scope&CacheScopeScratch != 0 {
+			err := clearDir(w.ScratchDir)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// clearDir removes the content of dir while keeping dir itself in place
+func clearDir(dir string) error {
+	if dir == "" || !util.PathExists(dir) {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read directory %s: %s", dir, err)
+	}
+
+	for _, entry := range entries {
+		err := os.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("unable to remove %s: %s", filepath.Join(dir, entry.Name()), err)
+		}
+	}
+
+	return nil
+}
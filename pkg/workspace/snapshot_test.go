@@ -0,0 +1,166 @@
+// Copyright (c) 2021, NVIDIA CORPORATION. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package workspace
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gvallee/go_util/pkg/util"
+)
+
+// newTestWorkspace creates and initializes a workspace rooted at a fresh
+// temporary directory, registering a cleanup to remove it.
+func newTestWorkspace(t *testing.T, name string) *Config {
+	t.Helper()
+
+	basedir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unable to create test directory: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(basedir) })
+
+	w := &Config{Name: name, Basedir: basedir}
+	if err := w.Init(); err != nil {
+		t.Fatalf("unable to initialize test workspace: %s", err)
+	}
+	return w
+}
+
+// writeTarGz writes a tar.gz archive at path with one entry per key/value
+// pair in entries, letting tests craft archives with arbitrary (including
+// malicious) entry names.
+func writeTarGz(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unable to create %s: %s", path, err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	defer gw.Close()
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	for name, content := range entries {
+		err := tw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: int64(len(content)),
+		})
+		if err != nil {
+			t.Fatalf("unable to write tar header for %s: %s", name, err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("unable to write tar content for %s: %s", name, err)
+		}
+	}
+}
+
+func TestSnapshotRestoreRoundTrip(t *testing.T) {
+	src := newTestWorkspace(t, "src_workspace")
+
+	installedFile := filepath.Join(src.InstallDir, "bin", "tool")
+	if err := os.MkdirAll(filepath.Dir(installedFile), defaultWPMode); err != nil {
+		t.Fatalf("unable to create %s: %s", filepath.Dir(installedFile), err)
+	}
+	if err := os.WriteFile(installedFile, []byte("installed tool"), 0644); err != nil {
+		t.Fatalf("unable to write %s: %s", installedFile, err)
+	}
+
+	archivePath, err := src.Snapshot("test_snapshot")
+	if err != nil {
+		t.Fatalf("Snapshot failed: %s", err)
+	}
+	if !util.PathExists(archivePath) {
+		t.Fatalf("snapshot archive was not created: %s", archivePath)
+	}
+
+	dst := newTestWorkspace(t, "dst_workspace")
+	if err := dst.RestoreSnapshot(archivePath); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %s", err)
+	}
+
+	restoredFile := filepath.Join(dst.InstallDir, "bin", "tool")
+	data, err := os.ReadFile(restoredFile)
+	if err != nil {
+		t.Fatalf("restored file %s is missing: %s", restoredFile, err)
+	}
+	if string(data) != "installed tool" {
+		t.Fatalf("restored file %s has unexpected content: %q", restoredFile, data)
+	}
+}
+
+func TestRestoreSnapshotRejectsPathTraversal(t *testing.T) {
+	w := newTestWorkspace(t, "test_workspace")
+
+	archivePath := filepath.Join(w.Basedir, "malicious.tar.gz")
+	writeTarGz(t, archivePath, map[string]string{
+		"install/../outside.txt": "pwned",
+	})
+
+	err := w.RestoreSnapshot(archivePath)
+	if err == nil {
+		t.Fatalf("RestoreSnapshot did not reject a path-traversal entry")
+	}
+
+	escaped := filepath.Join(w.Basedir, "outside.txt")
+	if util.PathExists(escaped) {
+		t.Fatalf("RestoreSnapshot wrote outside the workspace's install directory: %s", escaped)
+	}
+}
+
+func TestClone(t *testing.T) {
+	src := newTestWorkspace(t, "src_workspace")
+
+	dstBasedir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unable to create test directory: %s", err)
+	}
+	defer os.RemoveAll(dstBasedir)
+
+	dst := &Config{Basedir: dstBasedir}
+	if err := src.Clone(dst); err != nil {
+		t.Fatalf("Clone failed: %s", err)
+	}
+
+	if dst.Name != src.Name {
+		t.Fatalf("cloned workspace name = %q, want %q", dst.Name, src.Name)
+	}
+	if !util.PathExists(dst.InstallDir) {
+		t.Fatalf("cloned workspace's install directory was not created: %s", dst.InstallDir)
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	w := newTestWorkspace(t, "test_workspace")
+
+	buildFile := filepath.Join(w.BuildDir, "leftover")
+	if err := os.WriteFile(buildFile, []byte("stale"), 0644); err != nil {
+		t.Fatalf("unable to write %s: %s", buildFile, err)
+	}
+	downloadFile := filepath.Join(w.DownloadDir, "archive.tar.gz")
+	if err := os.WriteFile(downloadFile, []byte("data"), 0644); err != nil {
+		t.Fatalf("unable to write %s: %s", downloadFile, err)
+	}
+
+	if err := w.ClearCache(CacheScopeBuild); err != nil {
+		t.Fatalf("ClearCache failed: %s", err)
+	}
+
+	if util.PathExists(buildFile) {
+		t.Fatalf("ClearCache(CacheScopeBuild) left %s in place", buildFile)
+	}
+	if !util.PathExists(downloadFile) {
+		t.Fatalf("ClearCache(CacheScopeBuild) removed %s outside its scope", downloadFile)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gvallee/go_software_build/pkg/builder"
 	"github.com/gvallee/go_util/pkg/util"
@@ -60,81 +61,110 @@ type Config struct {
 
 	// MpirunArgs is the list of arguments that the users wants to be passed in when running mpirun commands
 	MpirunArgs string
+
+	// DirOverrides lets users override any of the standard workspace directories (e.g. "build", "install")
+	// with an absolute path instead of the default Basedir-relative one
+	DirOverrides map[string]string
+
+	// EnvVars is the set of environment variables that should be set whenever the workspace is used
+	EnvVars map[string]string
+
+	// ModuleHints is a list of environment module names (e.g. Lmod/Environment Modules) that are
+	// expected to be loaded when working within the workspace
+	ModuleHints []string
+
+	// InstalledSoftware is the list of software packages known to be installed in the workspace at
+	// the time the configuration file was last saved
+	InstalledSoftware []string
+
+	// InstalledSoftwareURLs maps a software name to the URL it was installed from, for the
+	// software currently tracked in InstalledSoftware
+	InstalledSoftwareURLs map[string]string
+
+	// lock tracks the on-disk lock currently held by this Config, if any, so that
+	// WithLock/WithReadLock are reentrant across nested calls (e.g. Load calling Init)
+	lock *workspaceLock
 }
 
 func (w *Config) setStructure() {
-	w.ScratchDir = filepath.Join(w.Basedir, "scratch")
-	w.DownloadDir = filepath.Join(w.Basedir, "download")
-	w.SrcDir = filepath.Join(w.Basedir, "src")
-	w.BuildDir = filepath.Join(w.Basedir, "build")
-	w.InstallDir = filepath.Join(w.Basedir, "install")
-	w.RunDir = filepath.Join(w.Basedir, "run")
+	w.ScratchDir = w.dirOrOverride("scratch")
+	w.DownloadDir = w.dirOrOverride("download")
+	w.SrcDir = w.dirOrOverride("src")
+	w.BuildDir = w.dirOrOverride("build")
+	w.InstallDir = w.dirOrOverride("install")
+	w.RunDir = w.dirOrOverride("run")
 }
 
-func (w *Config) Init() error {
-	if !util.IsDir(w.Basedir) {
-		err := os.MkdirAll(w.Basedir, defaultWPMode)
-		if err != nil {
-			return err
-		}
+// dirOrOverride returns the Basedir-relative path for a standard workspace
+// directory, unless the user specified a non-empty override for it, which is
+// used as given.
+func (w *Config) dirOrOverride(name string) string {
+	if override, ok := w.DirOverrides[name]; ok && override != "" {
+		return override
 	}
-	w.setStructure()
+	return filepath.Join(w.Basedir, name)
+}
 
-	if !util.PathExists(w.DownloadDir) {
-		// We use mkdirall for the first one so that is the basedirectory does not exist, it creates it
-		err := os.MkdirAll(w.DownloadDir, defaultWPMode)
-		if err != nil {
-			return fmt.Errorf("unable to create the workspace's download directory %s: %s", w.DownloadDir, err)
-		}
-	}
+func (w *Config) Init() error {
+	return w.WithLock(func() error {
+		w.setStructure()
 
-	if !util.PathExists(w.ScratchDir) {
-		err := os.Mkdir(w.ScratchDir, defaultWPMode)
-		if err != nil {
-			return fmt.Errorf("unable to create the workspace's scratch directory %s: %s", w.ScratchDir, err)
+		if !util.PathExists(w.DownloadDir) {
+			// We use mkdirall for the first one so that is the basedirectory does not exist, it creates it
+			err := os.MkdirAll(w.DownloadDir, defaultWPMode)
+			if err != nil {
+				return fmt.Errorf("unable to create the workspace's download directory %s: %s", w.DownloadDir, err)
+			}
 		}
-	}
 
-	if !util.PathExists(w.InstallDir) {
-		err := os.Mkdir(w.InstallDir, defaultWPMode)
-		if err != nil {
-			return fmt.Errorf("unable to create the workspace's install directory %s: %s", w.InstallDir, err)
+		if !util.PathExists(w.ScratchDir) {
+			err := os.Mkdir(w.ScratchDir, defaultWPMode)
+			if err != nil {
+				return fmt.Errorf("unable to create the workspace's scratch directory %s: %s", w.ScratchDir, err)
+			}
 		}
-	}
 
-	if !util.PathExists(w.BuildDir) {
-		err := os.Mkdir(w.BuildDir, defaultWPMode)
-		if err != nil {
-			return fmt.Errorf("unable to create the workspace's build directory %s: %s", w.BuildDir, err)
+		if !util.PathExists(w.InstallDir) {
+			err := os.Mkdir(w.InstallDir, defaultWPMode)
+			if err != nil {
+				return fmt.Errorf("unable to create the workspace's install directory %s: %s", w.InstallDir, err)
+			}
 		}
-	}
 
-	if !util.PathExists(w.SrcDir) {
-		err := os.Mkdir(w.SrcDir, defaultWPMode)
-		if err != nil {
-			return err
+		if !util.PathExists(w.BuildDir) {
+			err := os.Mkdir(w.BuildDir, defaultWPMode)
+			if err != nil {
+				return fmt.Errorf("unable to create the workspace's build directory %s: %s", w.BuildDir, err)
+			}
 		}
-	}
 
-	if !util.PathExists(w.RunDir) {
-		err := os.Mkdir(w.RunDir, defaultWPMode)
-		if err != nil {
-			return err
+		if !util.PathExists(w.SrcDir) {
+			err := os.Mkdir(w.SrcDir, defaultWPMode)
+			if err != nil {
+				return err
+			}
 		}
-	}
 
-	return nil
-}
+		if !util.PathExists(w.RunDir) {
+			err := os.Mkdir(w.RunDir, defaultWPMode)
+			if err != nil {
+				return err
+			}
+		}
 
-func (w *Config) getPathToConfigDir() string {
-	return filepath.Join(w.ConfDir, "."+w.Name)
+		return nil
+	})
 }
 
-func (w *Config) getConfigFilePath() string {
-	if w.ConfDir == "" {
-		w.ConfDir = os.Getenv("HOME")
+// getHomeDir returns the user's home directory, or an error if $HOME is not
+// set rather than silently falling back to an empty (and therefore
+// filesystem-root-relative) path.
+func getHomeDir() (string, error) {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return "", fmt.Errorf("$HOME is not set")
 	}
-	return filepath.Join(w.getPathToConfigDir(), configFileName)
+	return home, nil
 }
 
 func (w *Config) createDefaultConfigFile() error {
@@ -146,7 +176,10 @@ func (w *Config) createDefaultConfigFile() error {
 		return fmt.Errorf("configuration file is undefined")
 	}
 
-	configDir := w.getPathToConfigDir()
+	configDir, err := w.getPathToConfigDir()
+	if err != nil {
+		return err
+	}
 	if !util.PathExists(configDir) {
 		err := os.MkdirAll(configDir, defaultWPMode)
 		if err != nil {
@@ -156,7 +189,11 @@ func (w *Config) createDefaultConfigFile() error {
 
 	// If a base directory was not specified up front, use HOME by default
 	if w.Basedir == "" {
-		w.Basedir = os.Getenv("HOME")
+		home, err := getHomeDir()
+		if err != nil {
+			return err
+		}
+		w.Basedir = home
 	}
 	w.Basedir = filepath.Join(w.Basedir, w.Name+"_ws")
 	if !util.PathExists(w.Basedir) {
@@ -165,50 +202,64 @@ func (w *Config) createDefaultConfigFile() error {
 			return err
 		}
 	}
-	content := "dir=" + w.Basedir + "\n"
-	f, err := os.Create(w.ConfigFile)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	_, err = f.WriteString(content)
-	if err != nil {
-		return err
-	}
-	// close is deferred and we need to make sure the content is written to the file asap
-	err = f.Sync()
-	if err != nil {
-		return err
-	}
 
-	return nil
+	return w.writeConfigFile()
 }
 
+// ParseCfg loads the workspace's configuration file. It transparently supports
+// the legacy key=value format as well as the current structured (JSON/YAML)
+// format, and auto-migrates a legacy file to the current format in place.
 func (w *Config) ParseCfg() error {
 	if w.ConfigFile == "" {
 		return fmt.Errorf("configuration file is undefined")
 	}
 
-	kvs, err := kv.LoadKeyValueConfig(w.ConfigFile)
+	data, err := os.ReadFile(w.ConfigFile)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to read configuration file %s: %s", w.ConfigFile, err)
 	}
 
-	for _, keyvalue := range kvs {
-		if keyvalue.Key == "dir" {
+	switch detectConfigFormat(data) {
+	case formatJSON:
+		s, err := unmarshalSchema(data, formatJSON)
+		if err != nil {
+			return err
+		}
+		w.applySchema(s)
+		return w.migrateSchemaIfNeeded(s)
+	case formatYAML:
+		s, err := unmarshalSchema(data, formatYAML)
+		if err != nil {
+			return err
+		}
+		w.applySchema(s)
+		return w.migrateSchemaIfNeeded(s)
+	default:
+		// Legacy kv format: the only key we ever supported was "dir"
+		kvs, err := kv.LoadKeyValueConfig(w.ConfigFile)
+		if err != nil {
+			return err
+		}
+		for _, keyvalue := range kvs {
+			if keyvalue.Key != "dir" {
+				return fmt.Errorf("invalid key (%s)", keyvalue.Key)
+			}
 			w.Basedir = keyvalue.Value
-		} else {
-			return fmt.Errorf("invalid key (%s)", keyvalue.Key)
 		}
-	}
 
-	return nil
+		// Migrate the legacy file to the current structured format in place
+		return w.writeConfigFile()
+	}
 }
 
 func (w *Config) Load() error {
 	// Check if the configuration dir/file exists
 	if w.ConfigFile == "" {
-		w.ConfigFile = w.getConfigFilePath()
+		path, err := w.getConfigFilePath()
+		if err != nil {
+			return err
+		}
+		w.ConfigFile = path
 	}
 	if !util.FileExists(w.ConfigFile) {
 		err := w.createDefaultConfigFile()
@@ -225,16 +276,34 @@ func (w *Config) Load() error {
 		return err
 	}
 
-	if !util.PathExists(w.Basedir) {
-		err = w.Init()
-		if err != nil {
-			return err
+	// Checked before locking: acquiring the lock creates Basedir to hold the
+	// lock file.
+	needsInit := !util.PathExists(w.Basedir)
+	return w.WithLock(func() error {
+		if needsInit {
+			err := w.Init()
+			if err != nil {
+				return err
+			}
+		} else {
+			w.setStructure()
 		}
-	} else {
-		w.setStructure()
-	}
 
-	return nil
+		// A workspace that is loaded but not yet known to the registry is
+		// implicitly registered so single-workspace users never have to deal
+		// with the registry explicitly.
+		if w.Name != "" {
+			_, err := Get(w.Name)
+			if err != nil {
+				err = Register(w)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
 }
 
 func (w *Config) checkWorkspaceStructure() error {
@@ -261,31 +330,76 @@ func (w *Config) checkWorkspaceStructure() error {
 	return nil
 }
 
+// InstallSoftware builds and installs a package in the workspace. It is a
+// convenience wrapper around InstallSoftwareWithDeps for packages that are
+// unversioned and have no dependency on other workspace-managed software.
 func (w *Config) InstallSoftware(softwareName string, softwareURL string, configArgs []string) error {
+	return w.InstallSoftwareWithDeps(softwareName, softwareURL, "", configArgs, nil)
+}
+
+// InstallSoftwareWithDeps builds and installs a package in the workspace and
+// records it, along with version, configure arguments, and dependencies, in
+// the workspace's installed-software manifest (see ListInstalled,
+// UninstallSoftware, Reinstall).
+func (w *Config) InstallSoftwareWithDeps(softwareName string, softwareURL string, version string, configArgs []string, dependsOn []string) error {
 	// Sanity checks
 	err := w.checkWorkspaceStructure()
 	if err != nil {
 		return err
 	}
 
-	b := new(builder.Builder)
-	b.Env.ScratchDir = w.ScratchDir
-	b.Env.InstallDir = w.InstallDir
-	b.Env.BuildDir = filepath.Join(w.BuildDir, softwareName)
-	b.Env.SrcPath = filepath.Join(w.DownloadDir, softwareName)
-	b.ConfigureExtraArgs = configArgs
-	b.App.Name = softwareName
-	b.App.URL = softwareURL
-	err = b.Load(true)
-	if err != nil {
-		return err
-	}
-	res := b.Install()
-	if res.Err != nil {
-		return res.Err
-	}
+	return w.WithLock(func() error {
+		// The builder lays software out as InstallDir/<App.Name> (and keys BuildDir/
+		// SrcPath off the same name we give it), so a version has to be folded into
+		// the name itself to get a real InstallDir/<name>/<version> on disk -
+		// otherwise two versions of the same package collide on the same directory.
+		buildName := softwareName
+		if version != "" {
+			buildName = filepath.Join(softwareName, version)
+		}
 
-	return nil
+		b := new(builder.Builder)
+		b.Env.ScratchDir = w.ScratchDir
+		b.Env.InstallDir = w.InstallDir
+		b.Env.BuildDir = filepath.Join(w.BuildDir, buildName)
+		b.Env.SrcPath = filepath.Join(w.DownloadDir, buildName)
+		b.ConfigureExtraArgs = configArgs
+		b.App.Name = buildName
+		b.App.URL = softwareURL
+		err := b.Load(true)
+		if err != nil {
+			return err
+		}
+		res := b.Install()
+		if res.Err != nil {
+			return res.Err
+		}
+
+		if w.InstalledSoftwareURLs == nil {
+			w.InstalledSoftwareURLs = make(map[string]string)
+		}
+		w.InstalledSoftwareURLs[softwareName] = softwareURL
+		alreadyTracked := false
+		for _, name := range w.InstalledSoftware {
+			if name == softwareName {
+				alreadyTracked = true
+				break
+			}
+		}
+		if !alreadyTracked {
+			w.InstalledSoftware = append(w.InstalledSoftware, softwareName)
+		}
+
+		return w.recordInstall(InstalledSoftwareEntry{
+			Name:          softwareName,
+			URL:           softwareURL,
+			Version:       version,
+			ConfigureArgs: configArgs,
+			InstallPrefix: filepath.Join(w.InstallDir, buildName),
+			InstalledAt:   time.Now().UTC(),
+			DependsOn:     dependsOn,
+		})
+	})
 }
 
 func (w *Config) GetSoftwareInstallDir(softwareName string) string {
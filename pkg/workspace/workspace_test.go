@@ -8,7 +8,6 @@ package workspace
 import (
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"testing"
 
 	"github.com/gvallee/go_util/pkg/util"
@@ -34,7 +33,10 @@ func TestCreate(t *testing.T) {
 		t.Fatalf("workspace creation without a pre-existing configuration file succeeded")
 	}
 
-	configFile := filepath.Join(newWorkspace.ConfDir, "."+newWorkspace.Name, "workspace.conf")
+	// The configuration directory layout differs between release and dev
+	// builds; see config_release.go / config_dev.go and their _test.go
+	// counterparts for expectedConfigFilePath.
+	configFile := expectedConfigFilePath(newWorkspace.ConfDir, newWorkspace.Name)
 	if !util.PathExists(configFile) {
 		t.Fatalf("workspace configuration file was not properly created: %s", err)
 	}